@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// apiToken returns the shared admin token configured via the API_TOKEN
+// environment variable, following the single-token gate the p83.nl wiki
+// uses in front of its own admin routes rather than full IndieAuth. An
+// empty token means nothing can authenticate, so admin routes fail closed
+// rather than being left open by a missing env var.
+func apiToken() string {
+	return os.Getenv("API_TOKEN")
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>"
+// header, returning "" if the header is missing or malformed.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(auth, prefix)
+}
+
+// authorized reports whether r carries a bearer token matching API_TOKEN.
+func authorized(r *http.Request) bool {
+	token := apiToken()
+	if token == "" {
+		return false
+	}
+	supplied := bearerToken(r)
+	if supplied == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(supplied), []byte(token)) == 1
+}
+
+// requireAuth wraps next so it only runs once authorized(r) holds,
+// responding 401 otherwise. Use it on mutating routes; public reads
+// (/greetings, /search, /export) should stay unwrapped.
+func (s *server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			slog.Warn("rejected unauthenticated request", "path", r.URL.Path)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Handle the /auth/verify route so an admin panel can check whether its
+// stored token is still valid before rendering controls like "Clear".
+func (s *server) handleAuthVerify(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+)
+
+// avatarThumbnailSize is the fixed width/height, in pixels, that every
+// uploaded avatar is downscaled to before it's stored.
+const avatarThumbnailSize = 64
+
+// decodeAvatarThumbnail decodes an uploaded image (PNG, JPEG or GIF),
+// downscales it to a fixed avatarThumbnailSize x avatarThumbnailSize square,
+// and re-encodes it as PNG so avatars are stored and served in one format
+// regardless of what was uploaded.
+func decodeAvatarThumbnail(r io.Reader) ([]byte, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	thumb := thumbnail(src, avatarThumbnailSize)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumb); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// thumbnail resizes src to a size x size square using nearest-neighbor
+// sampling, which is simple and fast enough for small avatar images.
+func thumbnail(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		srcY := bounds.Min.Y + y*srcH/size
+		for x := 0; x < size; x++ {
+			srcX := bounds.Min.X + x*srcW/size
+			dst.Set(x, y, src.At(srcX, srcY))
+		}
+	}
+	return dst
+}
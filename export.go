@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// exportCSV streams the rows of an open *sql.Rows as CSV, one row at a time,
+// so the exporter never has to hold the full greetings slice in memory.
+func exportCSV(w io.Writer, rows *sql.Rows) error {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"first_name", "last_name", "message", "timestamp"}); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var g Greeting
+		if err := rows.Scan(&g.ID, &g.FirstName, &g.LastName, &g.Message, &g.Timestamp); err != nil {
+			return err
+		}
+		if err := writer.Write([]string{g.FirstName, g.LastName, g.Message, g.Timestamp}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exportJSON streams the rows of an open *sql.Rows as a JSON array without
+// buffering the whole result set first.
+func exportJSON(w io.Writer, rows *sql.Rows) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	first := true
+	for rows.Next() {
+		var g Greeting
+		if err := rows.Scan(&g.ID, &g.FirstName, &g.LastName, &g.Message, &g.Timestamp); err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		if err := encoder.Encode(g); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// exportOPML streams the rows of an open *sql.Rows as a flat OPML outline,
+// one <outline> element per greeting.
+func exportOPML(w io.Writer, rows *sql.Rows) error {
+	if _, err := io.WriteString(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<opml version=\"2.0\">\n<head><title>Greetings</title></head>\n<body>\n"); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var g Greeting
+		if err := rows.Scan(&g.ID, &g.FirstName, &g.LastName, &g.Message, &g.Timestamp); err != nil {
+			return err
+		}
+		line := fmt.Sprintf("<outline text=%q first_name=%q last_name=%q timestamp=%q/>\n",
+			g.Message, g.FirstName, g.LastName, g.Timestamp)
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "</body>\n</opml>\n")
+	return err
+}
+
+// isJSONFile reports whether the uploaded file's name looks like JSON,
+// falling back to CSV otherwise.
+func isJSONFile(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(filename), ".json")
+}
+
+// decodeGreetingsCSV parses an uploaded CSV file into a slice of Greeting.
+// The header row (if present) is detected by checking the first cell against
+// the known column name and skipped.
+func decodeGreetingsCSV(r io.Reader) ([]Greeting, error) {
+	reader := csv.NewReader(r)
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var greetings []Greeting
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && strings.EqualFold(record[0], "first_name") {
+			continue // skip header row
+		}
+		if len(record) < 4 {
+			continue
+		}
+		greetings = append(greetings, Greeting{
+			FirstName: record[0],
+			LastName:  record[1],
+			Message:   record[2],
+			Timestamp: record[3],
+		})
+	}
+	return greetings, nil
+}
+
+// decodeGreetingsJSON parses an uploaded JSON file into a slice of Greeting.
+// It accepts either a JSON array of greetings or newline-delimited JSON.
+func decodeGreetingsJSON(r io.Reader) ([]Greeting, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var greetings []Greeting
+
+	// try a plain JSON array first
+	if err := json.Unmarshal(raw, &greetings); err == nil {
+		return greetings, nil
+	}
+
+	// fall back to newline-delimited JSON objects
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	for decoder.More() {
+		var g Greeting
+		if err := decoder.Decode(&g); err != nil {
+			return nil, err
+		}
+		greetings = append(greetings, g)
+	}
+	return greetings, nil
+}
@@ -1,56 +1,33 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // Greeting represents a simple structure for a greeting message
 type Greeting struct {
+	ID        int    `json:"id"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Message   string `json:"message"`
 	Timestamp string `json:"timestamp"`
-}
-
-// global variables
-var greetings []Greeting // this slice store greetings messages
-var dataBase *sql.DB     // this connects to database
-var mu sync.Mutex        // to protect concurrent access to the greetings slice
-
-func initDatabase() {
-	log.Println("initializing database ")
-	var err error
-	dataBase, err = sql.Open("sqlite3", "./greetings.dataBase")
-	if err != nil {
-		log.Fatalf("error could not open database: %v", err)
-	}
-
-	// create table greetings if it does not exist
-	query := `
-CREATE TABLE IF NOT EXISTS greetings (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    first_name TEXT,
-    last_name TEXT,
-    message TEXT,
-    timestamp TEXT
-)`
-	log.Println("table does not exist. Creating table")
-
-	_, err = dataBase.Exec(query)
-	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
-	}
+	AvatarURL string `json:"avatar_url,omitempty"`
 }
 
 // holds data that will be passed to HTML
@@ -60,276 +37,459 @@ type PageData struct {
 	Message    string
 }
 
+// server wires the HTTP handlers to a Store, replacing the old package
+// globals (dataBase, mu) now that the store is responsible for its own
+// concurrency.
+type server struct {
+	store   Store
+	tmpl    *template.Template
+	jsData  []byte
+	metrics *metrics
+}
+
+// shutdownTimeout bounds how long graceful shutdown waits for in-flight
+// requests to finish before the server is torn down anyway.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
 
-	initDatabase()
-	defer dataBase.Close() // ensures data base is closed when main is running
+	dbDriver := flag.String("db-driver", "sqlite3", "database driver: sqlite3, postgres or mysql")
+	dbDSN := flag.String("db-dsn", "./greetings.dataBase", "database data source name")
+	flag.Parse()
 
-	// Serve static files from the "static" directory
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
+	slog.Info("initializing store", "driver", *dbDriver)
+	store, err := newStore(*dbDriver, *dbDSN)
+	if err != nil {
+		slog.Error("could not open database", "error", err)
+		os.Exit(1)
+	}
+	defer store.Close()
 
 	// Read the compiled JavaScript code from a file
 	jsData, err := os.ReadFile("main.js")
 	if err != nil {
-		log.Printf("Failed to read javascript file")
-		log.Fatalf("Failed to read JavaScript file: %v", err)
-
+		slog.Error("failed to read javascript file", "error", err)
+		os.Exit(1)
 	}
-	log.Println(" loaded Javascript file")
+	slog.Info("loaded javascript file")
 
 	// Load the HTML template from an external file
 	tmpl, err := template.ParseFiles("template.html")
 	if err != nil {
-		log.Fatalf("Failed to parse template file: %v", err)
-	}
-	log.Println("Loaded HTML template")
-
-	// Handle the root path and render the template
-	// "/" finds the root of the web server
-	// w http.ResponseWriter writes to the server
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Serving root path request...")
-		pageData := PageData{
-			Title:      "Go Generated Page",
-			JavaScript: template.JS(jsData), // javascript code that is inluded
-		}
+		slog.Error("failed to parse template file", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("loaded HTML template")
 
-		// tmpl.Execute(w, pageData) renders HTML page from the info stored in pageData
-		if err := tmpl.Execute(w, pageData); err != nil {
-			log.Printf("Failed to execute template: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
-	})
+	srv := &server{store: store, tmpl: tmpl, jsData: jsData, metrics: newMetrics()}
+
+	mux := http.NewServeMux()
 
-	// Handle the /greet route
-	http.HandleFunc("/greet", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Handling /greet request...")
-		// checks if request method is POST
-		if r.Method == http.MethodPost {
-
-			// writes the first and lastname to the database file
-			firstName := r.FormValue("first_name")
-			lastName := r.FormValue("last_name")
-
-			log.Printf("Received firstName: %s, lastName: %s", firstName, lastName) // Debug message
-
-			// error if names are null
-			if firstName == "" || lastName == "" {
-				log.Printf("Validation error missing first and lastnames")
-				http.Error(w, "First and last names are required", http.StatusBadRequest)
-				return
-			}
-
-			// message to comfirm that the grreting was recorded
-			message := fmt.Sprintf("Thank you, %s %s! Your greeting has been recorded.", firstName, lastName)
-
-			timestamp := time.Now().Format("2006-01-02 15:04:05")
-			// Add the new greeting to the global greetings slice
-
-			// mu.Lock() is used to ensure that only go routine can access the database at once
-			mu.Lock()
-			log.Println("Inserting greeting into database...")
-			_, err := dataBase.Exec("INSERT INTO greetings (first_name, last_name, message, timestamp) VALUES (?, ?, ?, ?)", firstName, lastName, message, timestamp)
-
-			mu.Unlock() // unlocks the database
-
-			if err != nil {
-				log.Printf("Failed to insert greeting: %v", err)
-				http.Error(w, "Error could not save greeting", http.StatusInternalServerError)
-				return
-			}
-
-			// creates a new instance of pagedata struct to pass the template to
-			pageData := PageData{
-				Title:      "Go Generated Page",
-				JavaScript: template.JS(jsData),
-				Message:    message,
-			}
-
-			if err := tmpl.Execute(w, pageData); err != nil {
-				log.Printf("Failed to execute template: %v", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			} else {
-				log.Println("Greeting processed and response sent successfully.") // Debug message
-			}
-		} else {
-			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	// Serve static files from the "static" directory
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
+
+	mux.HandleFunc("/", srv.withLogging(srv.handleIndex))
+	mux.HandleFunc("/greet", srv.withLogging(srv.requireAuth(srv.handleGreet)))
+	mux.HandleFunc("/greetings", srv.withLogging(srv.handleGreetings))
+	mux.HandleFunc("/greetings/", srv.withLogging(srv.requireAuth(srv.handleDeleteGreeting)))
+	mux.HandleFunc("/clear", srv.withLogging(srv.requireAuth(srv.handleClear)))
+	mux.HandleFunc("/search", srv.withLogging(srv.handleSearch))
+	mux.HandleFunc("/export", srv.withLogging(srv.handleExport))
+	mux.HandleFunc("/import", srv.withLogging(srv.requireAuth(srv.handleImport)))
+	mux.HandleFunc("/avatar/", srv.withLogging(srv.handleAvatar))
+	mux.HandleFunc("/auth/verify", srv.withLogging(srv.handleAuthVerify))
+	mux.HandleFunc("/metrics", srv.withLogging(srv.handleMetrics))
+
+	httpServer := &http.Server{Addr: ":8080", Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		slog.Info("server is running", "addr", httpServer.Addr)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("server failed", "error", err)
+			os.Exit(1)
 		}
-	})
+	}()
 
-	// Handle the /greetings route to return a list of greetings as JSON
-	http.HandleFunc("/greetings", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Handling /greetings request...")
-
-		if r.Method == http.MethodGet {
-			rows, err := dataBase.Query("SELECT first_name, last_name, message, timestamp FROM greetings")
-			if err != nil {
-				log.Printf("Failed to fetch greetings: %v", err)
-				http.Error(w, "Failed to fetch greetings", http.StatusInternalServerError)
-				return
-			}
-			defer rows.Close() // closes rows after it has been read
-
-			var greetings []Greeting //This is a slice
-			for rows.Next() {
-				var greeting Greeting
-				if err := rows.Scan(&greeting.FirstName, &greeting.LastName, &greeting.Message, &greeting.Timestamp); err != nil {
-					http.Error(w, "Failed to scan row", http.StatusInternalServerError)
-					return
-				}
-				greetings = append(greetings, greeting)
-			}
-
-			w.Header().Set("Content-Type", "application/json") // sets response content to JSON
-			if err := json.NewEncoder(w).Encode(greetings); err != nil {
-				http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
-			}
-		} else {
+	<-ctx.Done()
+	stop()
+	slog.Info("shutdown signal received, shutting down gracefully")
 
-		}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("graceful shutdown failed", "error", err)
+	}
+	slog.Info("server stopped")
+}
 
-	})
+// statusRecorder wraps a http.ResponseWriter to capture the status code
+// written, so the logging middleware can report it after the handler runs.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
 
-	// Handle the /clear route to clear the greetings log
-	http.HandleFunc("/clear", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Handling /clear request...")
-		// checks if the HTTP method is a post
-		if r.Method == http.MethodPost {
-			mu.Lock()
-			_, err := dataBase.Exec("DELETE FROM greetings") // this executes an SQL delete
-			mu.Unlock()
-			if err != nil {
-				log.Printf("Failed  clear log: %v", err)
-				http.Error(w, "Failed  clear log", http.StatusInternalServerError)
-				return
-			}
-			w.WriteHeader(http.StatusOK)
-			log.Println("Greetings log cleared successfully.")
-		} else {
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
 
-		}
-	})
+// withLogging wraps next so every request is logged as a single structured
+// line (method, path, status, duration, remote addr) and its latency is
+// recorded in the request_latency_ms histogram exposed at /metrics.
+func (s *server) withLogging(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next(rec, r)
+
+		duration := time.Since(start)
+		s.metrics.observeLatency(float64(duration.Microseconds()) / 1000)
+		slog.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", duration.Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		)
+	}
+}
 
-	// Handle the /search route to search for a specific greeting by first and last name
-	// "/search" will cause errors
-	http.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Handling /search request...")
+// Handle the /metrics route, exposing request counters and a request
+// latency histogram as JSON for a scraper to poll.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.metrics.snapshot())
+}
 
-		if r.Method != http.MethodGet {
-			log.Println("Invalid request method for /search")
-			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-			return
-		}
+// Handle the root path and render the template
+// "/" finds the root of the web server
+// w http.ResponseWriter writes to the server
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	pageData := PageData{
+		Title:      "Go Generated Page",
+		JavaScript: template.JS(s.jsData), // javascript code that is inluded
+	}
 
-		// gets the parameters from URL query string
-		firstName := r.URL.Query().Get("first_name")
-		lastName := r.URL.Query().Get("last_name")
-		startDateStr := r.URL.Query().Get("start_date")
-		endDateStr := r.URL.Query().Get("end_date")
-		log.Printf("Searching for firstName and %s, lastName: %s, StartDate: %s, EndDate: %s", firstName, lastName, startDateStr, endDateStr) // Debug message
-
-		// initialize start and end dates variables
-		var startDate, endDate time.Time
-		var err error
-
-		// parse date
-		// Parse start_date if provided
-		if startDateStr != "" {
-			startDate, err = time.Parse("2006-01-02", startDateStr)
-			if err != nil {
-				log.Printf("Invalid start_date format: %v", err)
-				http.Error(w, "Invalid start_date format. Use YYYY-MM-DD.", http.StatusBadRequest)
-				return
-			}
-		}
+	// tmpl.Execute(w, pageData) renders HTML page from the info stored in pageData
+	if err := s.tmpl.Execute(w, pageData); err != nil {
+		slog.Error("failed to execute template", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
 
-		// Parse end_date if provided
-		if endDateStr != "" {
-			endDate, err = time.Parse("2006-01-02", endDateStr)
-			if err != nil {
-				log.Printf("Invalid end_date format: %v", err)
-				http.Error(w, "Invalid end_date format. Use YYYY-MM-DD.", http.StatusBadRequest)
-				return
-			}
-		}
+// Handle the /greet route
+func (s *server) handleGreet(w http.ResponseWriter, r *http.Request) {
+	// checks if request method is POST
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
 
-		// SQL query built here
-		query := "SELECT first_name, last_name, message, timestamp FROM greetings"
-		var queryParams []interface{}
-		var conditions []string
+	// writes the first and lastname to the database file
+	firstName := r.FormValue("first_name")
+	lastName := r.FormValue("last_name")
 
-		// conditions based on parameters
-		if firstName != "" {
-			conditions = append(conditions, "first_name = ?") // querys SQL and appends first_name to conditions slice
-			queryParams = append(queryParams, firstName)
-		}
+	// error if names are null
+	if firstName == "" || lastName == "" {
+		slog.Warn("missing first or last name on /greet")
+		http.Error(w, "First and last names are required", http.StatusBadRequest)
+		return
+	}
 
-		if lastName != "" {
-			conditions = append(conditions, "last_name = ?")
-			queryParams = append(queryParams, lastName)
-		}
+	// message to comfirm that the grreting was recorded
+	message := fmt.Sprintf("Thank you, %s %s! Your greeting has been recorded.", firstName, lastName)
 
-		if !startDate.IsZero() {
-			conditions = append(conditions, "DATE(timestamp) >= ?")
-			queryParams = append(queryParams, startDate.Format("2006-01-02"))
-		}
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
 
-		if !endDate.IsZero() {
-			conditions = append(conditions, "DATE(timestamp) <= ?")
-			queryParams = append(queryParams, endDate.Format("2006-01-02"))
-		}
+	// the avatar is optional, so a missing file is not an error
+	var avatarHash string
+	if avatarFile, _, err := r.FormFile("avatar"); err == nil {
+		defer avatarFile.Close()
 
-		if len(conditions) > 0 {
-			query += " WHERE " + strings.Join(conditions, " AND ")
+		thumb, err := decodeAvatarThumbnail(avatarFile)
+		if err != nil {
+			slog.Warn("failed to decode uploaded avatar", "error", err)
+			http.Error(w, "Could not decode avatar image", http.StatusBadRequest)
+			return
 		}
 
-		// Execute the query
-		mu.Lock()
-		rows, err := dataBase.Query(query, queryParams...) // querys the database and places it in rows and also used for err
-		mu.Unlock()
+		avatarHash, err = s.store.SaveAvatar(thumb)
 		if err != nil {
-			log.Printf("Database query failed: %v", err)
-			http.Error(w, "Database query failed", http.StatusInternalServerError)
+			slog.Error("failed to save avatar", "error", err)
+			http.Error(w, "Error could not save avatar", http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		// Collect results
-		var results []Greeting
-		for rows.Next() {
-			var g Greeting
-			err := rows.Scan(&g.FirstName, &g.LastName, &g.Message, &g.Timestamp)
-			if err != nil {
-				log.Printf("Failed to scan row: %v", err)
-				http.Error(w, "Failed to process results", http.StatusInternalServerError)
-				return
-			}
-			results = append(results, g) // appends the scanned greeting to the slice results
-		}
+	}
+
+	if err := s.store.Insert(Greeting{FirstName: firstName, LastName: lastName, Message: message, Timestamp: timestamp}, avatarHash); err != nil {
+		slog.Error("failed to insert greeting", "error", err)
+		http.Error(w, "Error could not save greeting", http.StatusInternalServerError)
+		return
+	}
+	s.metrics.incGreetingsTotal()
+
+	// creates a new instance of pagedata struct to pass the template to
+	pageData := PageData{
+		Title:      "Go Generated Page",
+		JavaScript: template.JS(s.jsData),
+		Message:    message,
+	}
+
+	if err := s.tmpl.Execute(w, pageData); err != nil {
+		slog.Error("failed to execute template", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Handle the /greetings route to return a list of greetings as JSON
+func (s *server) handleGreetings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	greetings, err := s.store.List(Filter{})
+	if err != nil {
+		slog.Error("failed to fetch greetings", "error", err)
+		http.Error(w, "Failed to fetch greetings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json") // sets response content to JSON
+	if err := json.NewEncoder(w).Encode(greetings); err != nil {
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+	}
+}
+
+// Handle the /clear route to clear the greetings log
+func (s *server) handleClear(w http.ResponseWriter, r *http.Request) {
+	// checks if the HTTP method is a post
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
 
-		// Check for errors after iteration
-		if err = rows.Err(); err != nil {
-			log.Printf("Error iterating over rows: %v", err)
-			http.Error(w, "Error processing results", http.StatusInternalServerError)
+	if err := s.store.Clear(); err != nil {
+		slog.Error("failed to clear log", "error", err)
+		http.Error(w, "Failed  clear log", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	slog.Info("greetings log cleared")
+}
+
+// Handle DELETE /greetings/{id} to remove a single greeting.
+func (s *server) handleDeleteGreeting(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/greetings/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid greeting id", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.Delete(id); err != nil {
+		slog.Error("failed to delete greeting", "id", id, "error", err)
+		http.Error(w, "Failed to delete greeting", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	slog.Info("greeting deleted", "id", id)
+}
+
+// defaultSearchLimit is the page size /search uses when limit= is omitted,
+// so a forgotten query parameter can't load the whole table. A limit that
+// is not a positive integer is rejected with 400; a larger explicit limit
+// is used as given.
+const defaultSearchLimit = 20
+
+// searchResponse wraps a page of full-text search results with the
+// pagination metadata needed to fetch the next page.
+type searchResponse struct {
+	Results    []SearchResult `json:"results"`
+	Total      int            `json:"total"`
+	NextOffset *int           `json:"next_offset,omitempty"`
+}
+
+// Handle the /search route to run a free-text search over first_name,
+// last_name and message, returning a paginated, ranked page of results.
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit, must be a positive integer", http.StatusBadRequest)
 			return
 		}
+		limit = parsed
+	}
 
-		// Return results as JSON
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK) // this sends status code success
-		err = json.NewEncoder(w).Encode(results)
-		if err != nil {
-			log.Printf("Failed to encode results to JSON: %v", err)
-			http.Error(w, "Failed to encode results", http.StatusInternalServerError)
+	offset := 0
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		parsed, err := strconv.Atoi(offsetStr)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid offset, must be a non-negative integer", http.StatusBadRequest)
 			return
 		}
+		offset = parsed
+	}
 
-		log.Printf("Search successful, returned %d results.", len(results)) // this logs the amount results
-	})
+	sort := r.URL.Query().Get("sort")
+	switch sort {
+	case "":
+		sort = "score_desc"
+	case "timestamp_asc", "timestamp_desc", "score_desc":
+	default:
+		http.Error(w, "Invalid sort, want timestamp_asc, timestamp_desc or score_desc", http.StatusBadRequest)
+		return
+	}
+
+	results, total, err := s.store.SearchFullText(q, limit, offset, sort)
+	if err != nil {
+		slog.Error("search query failed", "q", q, "error", err)
+		http.Error(w, "Database query failed", http.StatusInternalServerError)
+		return
+	}
+	s.metrics.incSearchRequestsTotal()
+
+	resp := searchResponse{Results: results, Total: total}
+	if next := offset + len(results); next < total {
+		resp.NextOffset = &next
+	}
+
+	// Return results as JSON
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // this sends status code success
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("failed to encode search results", "error", err)
+		http.Error(w, "Failed to encode results", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Handle the /export route to download the full greetings log
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	filename := fmt.Sprintf("greetings-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+	case "opml":
+		w.Header().Set("Content-Type", "text/x-opml")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+	default:
+		http.Error(w, "Unknown format, use csv, json or opml", http.StatusBadRequest)
+		return
+	}
 
-	// Start the HTTP server
-	log.Println("Server is running on http://localhost:8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := s.store.Export(w, format); err != nil {
+		slog.Error("failed to export greetings", "format", format, "error", err)
+		http.Error(w, "Failed to export greetings", http.StatusInternalServerError)
+	}
+}
+
+// Handle the /avatar/{hash}.png route to serve a cached avatar thumbnail
+func (s *server) handleAvatar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hash := strings.TrimPrefix(r.URL.Path, "/avatar/")
+	hash = strings.TrimSuffix(hash, ".png")
+	if hash == "" {
+		http.Error(w, "Missing avatar hash", http.StatusBadRequest)
+		return
+	}
+
+	data, err := s.store.GetAvatar(hash)
+	if err != nil {
+		slog.Warn("avatar not found", "hash", hash, "error", err)
+		http.Error(w, "Avatar not found", http.StatusNotFound)
+		return
 	}
+
+	// the hash is content-addressed, so the image behind it never changes
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Write(data)
+}
+
+// Handle the /import route to bulk load greetings from a CSV or JSON file
+func (s *server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		slog.Warn("missing uploaded file on /import", "error", err)
+		http.Error(w, "Missing uploaded file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	var incoming []Greeting
+	if isJSONFile(header.Filename) {
+		incoming, err = decodeGreetingsJSON(file)
+	} else {
+		incoming, err = decodeGreetingsCSV(file)
+	}
+	if err != nil {
+		slog.Warn("failed to parse import file", "filename", header.Filename, "error", err)
+		http.Error(w, "Failed to parse import file", http.StatusBadRequest)
+		return
+	}
+
+	inserted, err := s.store.Import(incoming)
+	if err != nil {
+		slog.Error("failed to import greetings", "error", err)
+		http.Error(w, "Failed to import greetings", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("import complete", "inserted", inserted, "received", len(incoming))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"received": len(incoming),
+		"inserted": inserted,
+	})
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// metrics is a small in-process registry of counters and a request-latency
+// histogram, exposed as JSON by /metrics. It plays the role here that
+// rcrowley/go-metrics plays in Skia's webtry: a process-wide place for
+// handlers to bump counters and for /metrics to read them back out.
+type metrics struct {
+	greetingsTotal      int64
+	searchRequestsTotal int64
+
+	mu      sync.Mutex
+	latency latencyHistogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{latency: newLatencyHistogram()}
+}
+
+func (m *metrics) incGreetingsTotal() {
+	atomic.AddInt64(&m.greetingsTotal, 1)
+}
+
+func (m *metrics) incSearchRequestsTotal() {
+	atomic.AddInt64(&m.searchRequestsTotal, 1)
+}
+
+func (m *metrics) observeLatency(ms float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency.observe(ms)
+}
+
+// metricsSnapshot is the JSON shape returned by /metrics.
+type metricsSnapshot struct {
+	GreetingsTotal      int64         `json:"greetings_total"`
+	SearchRequestsTotal int64         `json:"search_requests_total"`
+	RequestLatencyMs    histogramSnap `json:"request_latency_ms"`
+}
+
+func (m *metrics) snapshot() metricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return metricsSnapshot{
+		GreetingsTotal:      atomic.LoadInt64(&m.greetingsTotal),
+		SearchRequestsTotal: atomic.LoadInt64(&m.searchRequestsTotal),
+		RequestLatencyMs:    m.latency.snapshot(),
+	}
+}
+
+// latencyHistogram is a fixed-bucket histogram of request latencies in
+// milliseconds. Callers must hold metrics.mu.
+type latencyHistogram struct {
+	bounds []float64 // upper bound of each bucket, in ms
+	counts []int64   // counts[i] is the number of observations in (bounds[i-1], bounds[i]]; the last entry catches everything above the largest bound
+	count  int64
+	sum    float64
+}
+
+func newLatencyHistogram() latencyHistogram {
+	return latencyHistogram{
+		bounds: []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000},
+		counts: make([]int64, 11),
+	}
+}
+
+func (h *latencyHistogram) observe(ms float64) {
+	h.count++
+	h.sum += ms
+	for i, bound := range h.bounds {
+		if ms <= bound {
+			h.counts[i]++
+			return
+		}
+	}
+	h.counts[len(h.counts)-1]++
+}
+
+// histogramSnap is the JSON shape of a latencyHistogram, keying each bucket
+// by its upper bound ("bucket_<bound>", with the overflow bucket as
+// "bucket_inf"). Unlike Prometheus's "le_" convention, these counts are
+// per-bucket, not cumulative: each observation is counted in exactly one
+// bucket, not every bucket whose bound it falls under.
+type histogramSnap struct {
+	Count   int64            `json:"count"`
+	SumMs   float64          `json:"sum_ms"`
+	Buckets map[string]int64 `json:"buckets"`
+}
+
+func (h *latencyHistogram) snapshot() histogramSnap {
+	buckets := make(map[string]int64, len(h.counts))
+	for i, bound := range h.bounds {
+		buckets[fmt.Sprintf("bucket_%g", bound)] = h.counts[i]
+	}
+	buckets["bucket_inf"] = h.counts[len(h.counts)-1]
+	return histogramSnap{Count: h.count, SumMs: h.sum, Buckets: buckets}
+}
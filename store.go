@@ -0,0 +1,601 @@
+package main
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Filter describes the constraints used by List to narrow down which
+// greetings are returned.
+type Filter struct {
+	FirstName string
+	LastName  string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// SearchResult pairs a Greeting with its relevance Score from a full-text
+// search. Score is omitted for non-ranked results.
+type SearchResult struct {
+	Greeting
+	Score float64 `json:"score,omitempty"`
+}
+
+// Store is the persistence boundary for greetings. Each backend owns its own
+// schema DDL and parameter-placeholder dialect (? vs $1) and is free to pick
+// whatever driver-specific setup it needs, as long as it satisfies this
+// interface. Real databases serialize writes themselves, so callers no
+// longer need to hold a mutex around Store calls.
+type Store interface {
+	Insert(g Greeting, avatarHash string) error
+	List(f Filter) ([]Greeting, error)
+	// SearchFullText runs a free-text search for q across first_name,
+	// last_name and message, returning at most limit results starting at
+	// offset, ordered by sort ("timestamp_asc", "timestamp_desc" or
+	// "score_desc"), along with the total number of matches.
+	SearchFullText(q string, limit, offset int, sort string) ([]SearchResult, int, error)
+	// Delete removes the greeting with the given id.
+	Delete(id int) error
+	Clear() error
+	Export(w io.Writer, format string) error
+	Import(greetings []Greeting) (int, error)
+	// SaveAvatar stores the (already thumbnailed) PNG data and returns its
+	// content hash, deduplicating identical images across greetings.
+	SaveAvatar(png []byte) (hash string, err error)
+	// GetAvatar returns the PNG bytes previously stored under hash.
+	GetAvatar(hash string) ([]byte, error)
+	Close() error
+}
+
+// sqlStore holds the behaviour that is identical across every database/sql
+// backend; only the schema DDL and the placeholder dialect differ between
+// drivers, so each concrete backend embeds this and supplies those two bits.
+type sqlStore struct {
+	db *sql.DB
+	// ph returns the nth (1-indexed) placeholder for this driver's dialect,
+	// e.g. "?" for sqlite3/mysql or "$1" for postgres.
+	ph func(n int) string
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) Insert(g Greeting, avatarHash string) error {
+	query := fmt.Sprintf(
+		"INSERT INTO greetings (first_name, last_name, message, timestamp, avatar_hash) VALUES (%s, %s, %s, %s, %s)",
+		s.ph(1), s.ph(2), s.ph(3), s.ph(4), s.ph(5),
+	)
+	_, err := s.db.Exec(query, g.FirstName, g.LastName, g.Message, g.Timestamp, avatarHash)
+	return err
+}
+
+func (s *sqlStore) List(f Filter) ([]Greeting, error) {
+	return s.query(f)
+}
+
+// query builds and runs a SELECT with whichever conditions are set on f,
+// using this store's placeholder dialect.
+func (s *sqlStore) query(f Filter) ([]Greeting, error) {
+	query := "SELECT id, first_name, last_name, message, timestamp, avatar_hash FROM greetings"
+
+	var conditions []string
+	var args []interface{}
+	next := 1
+	add := func(cond string, arg interface{}) {
+		conditions = append(conditions, fmt.Sprintf(cond, s.ph(next)))
+		args = append(args, arg)
+		next++
+	}
+
+	if f.FirstName != "" {
+		add("first_name = %s", f.FirstName)
+	}
+	if f.LastName != "" {
+		add("last_name = %s", f.LastName)
+	}
+	if !f.StartDate.IsZero() {
+		add("DATE(timestamp) >= %s", f.StartDate.Format("2006-01-02"))
+	}
+	if !f.EndDate.IsZero() {
+		add("DATE(timestamp) <= %s", f.EndDate.Format("2006-01-02"))
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []Greeting
+	for rows.Next() {
+		var g Greeting
+		var avatarHash string
+		if err := rows.Scan(&g.ID, &g.FirstName, &g.LastName, &g.Message, &g.Timestamp, &avatarHash); err != nil {
+			return nil, err
+		}
+		if avatarHash != "" {
+			g.AvatarURL = "/avatar/" + avatarHash + ".png"
+		}
+		results = append(results, g)
+	}
+	return results, rows.Err()
+}
+
+// SearchFullText is the generic fallback used by backends without a native
+// full-text index: it matches q as a substring of first_name, last_name or
+// message and leaves Score unset.
+func (s *sqlStore) SearchFullText(q string, limit, offset int, sort string) ([]SearchResult, int, error) {
+	pattern := "%" + q + "%"
+	matchClause := fmt.Sprintf(
+		"first_name LIKE %s OR last_name LIKE %s OR message LIKE %s",
+		s.ph(1), s.ph(2), s.ph(3),
+	)
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM greetings WHERE " + matchClause
+	if err := s.db.QueryRow(countQuery, pattern, pattern, pattern).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(
+		"SELECT id, first_name, last_name, message, timestamp, avatar_hash FROM greetings WHERE %s ORDER BY %s LIMIT %s OFFSET %s",
+		matchClause, sortClause(sort), s.ph(4), s.ph(5),
+	)
+	rows, err := s.db.Query(query, pattern, pattern, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var g Greeting
+		var avatarHash string
+		if err := rows.Scan(&g.ID, &g.FirstName, &g.LastName, &g.Message, &g.Timestamp, &avatarHash); err != nil {
+			return nil, 0, err
+		}
+		if avatarHash != "" {
+			g.AvatarURL = "/avatar/" + avatarHash + ".png"
+		}
+		results = append(results, SearchResult{Greeting: g})
+	}
+	return results, total, rows.Err()
+}
+
+// sortClause maps a /search sort= value to an ORDER BY clause. Backends
+// without a relevance score (everything but sqlite's FTS5 path) fall back
+// to timestamp ordering for "score_desc" since there is no score to sort by.
+func sortClause(sort string) string {
+	switch sort {
+	case "timestamp_desc":
+		return "timestamp DESC"
+	default:
+		return "timestamp ASC"
+	}
+}
+
+// Delete removes the greeting with the given id. Deleting a row that
+// doesn't exist is not an error.
+func (s *sqlStore) Delete(id int) error {
+	query := fmt.Sprintf("DELETE FROM greetings WHERE id = %s", s.ph(1))
+	_, err := s.db.Exec(query, id)
+	return err
+}
+
+func (s *sqlStore) Clear() error {
+	_, err := s.db.Exec("DELETE FROM greetings")
+	return err
+}
+
+// Export streams the greetings table straight out of the database in the
+// requested format, rather than buffering the full result set in memory.
+func (s *sqlStore) Export(w io.Writer, format string) error {
+	rows, err := s.db.Query("SELECT id, first_name, last_name, message, timestamp FROM greetings ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	switch format {
+	case "json":
+		return exportJSON(w, rows)
+	case "opml":
+		return exportOPML(w, rows)
+	case "csv":
+		return exportCSV(w, rows)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// Import inserts the given greetings inside a single transaction, skipping
+// any row that already exists with the same (first_name, last_name,
+// timestamp) so the same export file can be re-imported safely.
+func (s *sqlStore) Import(greetings []Greeting) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	checkQuery := fmt.Sprintf(
+		"SELECT 1 FROM greetings WHERE first_name = %s AND last_name = %s AND timestamp = %s",
+		s.ph(1), s.ph(2), s.ph(3),
+	)
+	checkStmt, err := tx.Prepare(checkQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer checkStmt.Close()
+
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO greetings (first_name, last_name, message, timestamp, avatar_hash) VALUES (%s, %s, %s, %s, %s)",
+		s.ph(1), s.ph(2), s.ph(3), s.ph(4), s.ph(5),
+	)
+	insertStmt, err := tx.Prepare(insertQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer insertStmt.Close()
+
+	inserted := 0
+	for _, g := range greetings {
+		var exists int
+		err := checkStmt.QueryRow(g.FirstName, g.LastName, g.Timestamp).Scan(&exists)
+		if err == nil {
+			continue // duplicate, skip
+		}
+		if err != sql.ErrNoRows {
+			return inserted, err
+		}
+
+		// imported rows never carry an avatar
+		if _, err := insertStmt.Exec(g.FirstName, g.LastName, g.Message, g.Timestamp, ""); err != nil {
+			return inserted, err
+		}
+		inserted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return inserted, err
+	}
+	return inserted, nil
+}
+
+// SaveAvatar stores the PNG data keyed by its MD5 hash, using an upsert so
+// two concurrent uploads of the same image race safely instead of the
+// second one failing the avatars table's hash primary key. Works for
+// sqlite3 and postgres, which both support the standard ON CONFLICT
+// clause; mysqlStore overrides this with INSERT IGNORE.
+func (s *sqlStore) SaveAvatar(png []byte) (string, error) {
+	sum := md5.Sum(png)
+	hash := hex.EncodeToString(sum[:])
+
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO avatars (hash, data) VALUES (%s, %s) ON CONFLICT (hash) DO NOTHING",
+		s.ph(1), s.ph(2),
+	)
+	if _, err := s.db.Exec(insertQuery, hash, png); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// GetAvatar returns the PNG bytes stored under hash.
+func (s *sqlStore) GetAvatar(hash string) ([]byte, error) {
+	query := fmt.Sprintf("SELECT data FROM avatars WHERE hash = %s", s.ph(1))
+	var data []byte
+	err := s.db.QueryRow(query, hash).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// addColumnIfMissing runs an ALTER TABLE ADD COLUMN against a baseline
+// database that predates that column, ignoring the driver-specific error
+// sqlite3 and MySQL return when the column already exists (neither
+// supports "ADD COLUMN IF NOT EXISTS").
+func addColumnIfMissing(db *sql.DB, alterSQL string) error {
+	_, err := db.Exec(alterSQL)
+	if err == nil || strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+		return nil
+	}
+	return err
+}
+
+// questionMark is the placeholder dialect shared by sqlite3 and mysql.
+func questionMark(n int) string {
+	return "?"
+}
+
+// dollarPlaceholder is the placeholder dialect used by postgres.
+func dollarPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// sqliteStore is the default, file-based backend.
+type sqliteStore struct {
+	*sqlStore
+}
+
+// newSQLiteStore opens (creating if needed) a SQLite-backed Store at dsn.
+// Its schema includes an fts5 virtual table, so the sqlite3 build tag this
+// binary is compiled with must be "sqlite_fts5" (e.g.
+// `go build -tags sqlite_fts5 ./...`) - mattn/go-sqlite3 doesn't compile
+// FTS5 support by default, and without the tag this fails at startup with
+// "no such module: fts5".
+func newSQLiteStore(dsn string) (Store, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer at a time; database/sql's connection pool
+	// doesn't know that; so cap the pool at a single connection and give
+	// concurrent writers a busy timeout instead of an immediate "database is
+	// locked" error.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to set busy_timeout: %w", err)
+	}
+
+	// greetings_fts is an external-content fts5 table, so its rowid set always
+	// mirrors greetings even before the index itself has been populated -
+	// there's no query against greetings_fts that distinguishes "just created,
+	// not yet backfilled" from "up to date". So check for its existence before
+	// running the schema below, while that's still knowable.
+	ftsTableExisted, err := tableExists(db, "greetings_fts")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to check for greetings_fts: %w", err)
+	}
+
+	schema := `
+CREATE TABLE IF NOT EXISTS greetings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    first_name TEXT,
+    last_name TEXT,
+    message TEXT,
+    timestamp TEXT,
+    avatar_hash TEXT DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS avatars (
+    hash TEXT PRIMARY KEY,
+    data BLOB
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS greetings_fts USING fts5(
+    first_name, last_name, message, content='greetings', content_rowid='id'
+);
+CREATE TRIGGER IF NOT EXISTS greetings_fts_ai AFTER INSERT ON greetings BEGIN
+    INSERT INTO greetings_fts(rowid, first_name, last_name, message)
+    VALUES (new.id, new.first_name, new.last_name, new.message);
+END;
+CREATE TRIGGER IF NOT EXISTS greetings_fts_ad AFTER DELETE ON greetings BEGIN
+    INSERT INTO greetings_fts(greetings_fts, rowid, first_name, last_name, message)
+    VALUES ('delete', old.id, old.first_name, old.last_name, old.message);
+END`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			return nil, fmt.Errorf("failed to create table: %w (mattn/go-sqlite3 must be built with -tags sqlite_fts5 for the default sqlite3 driver to support full-text search)", err)
+		}
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	// migrate a baseline database created before avatar_hash existed
+	if err := addColumnIfMissing(db, "ALTER TABLE greetings ADD COLUMN avatar_hash TEXT DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate avatar_hash column: %w", err)
+	}
+
+	// greetings_fts is only kept in sync going forward, by the triggers above;
+	// a database that already had greetings rows before this upgrade needs a
+	// one-time rebuild to seed the index, or /search would silently find
+	// nothing for any row inserted before greetings_fts existed. This only
+	// runs the first time greetings_fts is created: once the triggers are
+	// populating it, a rebuild would just redo work they've already done.
+	if !ftsTableExisted {
+		var greetingsCount int
+		if err := db.QueryRow("SELECT COUNT(*) FROM greetings").Scan(&greetingsCount); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to count greetings: %w", err)
+		}
+		if greetingsCount > 0 {
+			if _, err := db.Exec("INSERT INTO greetings_fts(greetings_fts) VALUES ('rebuild')"); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("failed to backfill greetings_fts: %w", err)
+			}
+		}
+	}
+
+	return &sqliteStore{&sqlStore{db: db, ph: questionMark}}, nil
+}
+
+// tableExists reports whether name is already a table or virtual table in
+// db, by consulting sqlite_master rather than querying the table itself -
+// querying an fts5 external-content table doesn't reliably tell you whether
+// its index has been populated yet, only whether the underlying content
+// table has rows.
+func tableExists(db *sql.DB, name string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", name).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SearchFullText overrides the generic LIKE-based fallback with SQLite's
+// FTS5 virtual table, ranking matches with BM25. bm25() scores lower-is-
+// better, so it's negated to make the exposed score higher-is-better.
+func (s *sqliteStore) SearchFullText(q string, limit, offset int, sort string) ([]SearchResult, int, error) {
+	// FTS5 treats MATCH's argument as a query in its own mini-language, where
+	// things like an unbalanced ", a (, a leading * or a trailing - are
+	// syntax errors rather than literal text. Quoting q as a single phrase
+	// (escaping embedded ") makes arbitrary user input match literally
+	// instead of 500ing the /search endpoint.
+	ftsQuery := `"` + strings.ReplaceAll(q, `"`, `""`) + `"`
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM greetings_fts WHERE greetings_fts MATCH ?", ftsQuery).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	orderBy := "score DESC"
+	switch sort {
+	case "timestamp_asc":
+		orderBy = "g.timestamp ASC"
+	case "timestamp_desc":
+		orderBy = "g.timestamp DESC"
+	}
+
+	query := fmt.Sprintf(`
+SELECT g.id, g.first_name, g.last_name, g.message, g.timestamp, g.avatar_hash, -bm25(greetings_fts) AS score
+FROM greetings_fts
+JOIN greetings g ON g.id = greetings_fts.rowid
+WHERE greetings_fts MATCH ?
+ORDER BY %s
+LIMIT ? OFFSET ?`, orderBy)
+
+	rows, err := s.db.Query(query, ftsQuery, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var g Greeting
+		var avatarHash string
+		var score float64
+		if err := rows.Scan(&g.ID, &g.FirstName, &g.LastName, &g.Message, &g.Timestamp, &avatarHash, &score); err != nil {
+			return nil, 0, err
+		}
+		if avatarHash != "" {
+			g.AvatarURL = "/avatar/" + avatarHash + ".png"
+		}
+		results = append(results, SearchResult{Greeting: g, Score: score})
+	}
+	return results, total, rows.Err()
+}
+
+// postgresStore backs the greetings table with Postgres.
+type postgresStore struct {
+	*sqlStore
+}
+
+func newPostgresStore(dsn string) (Store, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := `
+CREATE TABLE IF NOT EXISTS greetings (
+    id SERIAL PRIMARY KEY,
+    first_name TEXT,
+    last_name TEXT,
+    message TEXT,
+    timestamp TEXT,
+    avatar_hash TEXT DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS avatars (
+    hash TEXT PRIMARY KEY,
+    data BYTEA
+)`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	// migrate a baseline database created before avatar_hash existed
+	if _, err := db.Exec("ALTER TABLE greetings ADD COLUMN IF NOT EXISTS avatar_hash TEXT DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate avatar_hash column: %w", err)
+	}
+
+	return &postgresStore{&sqlStore{db: db, ph: dollarPlaceholder}}, nil
+}
+
+// mysqlStore backs the greetings table with MySQL.
+type mysqlStore struct {
+	*sqlStore
+}
+
+func newMySQLStore(dsn string) (Store, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := `
+CREATE TABLE IF NOT EXISTS greetings (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    first_name TEXT,
+    last_name TEXT,
+    message TEXT,
+    timestamp TEXT,
+    avatar_hash TEXT DEFAULT ''
+)`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	// migrate a baseline database created before avatar_hash existed
+	if err := addColumnIfMissing(db, "ALTER TABLE greetings ADD COLUMN avatar_hash TEXT DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate avatar_hash column: %w", err)
+	}
+
+	avatarsSchema := `
+CREATE TABLE IF NOT EXISTS avatars (
+    hash VARCHAR(32) PRIMARY KEY,
+    data BLOB
+)`
+	if _, err := db.Exec(avatarsSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create avatars table: %w", err)
+	}
+
+	return &mysqlStore{&sqlStore{db: db, ph: questionMark}}, nil
+}
+
+// SaveAvatar overrides the generic ON CONFLICT upsert with MySQL's INSERT
+// IGNORE, since MySQL doesn't support the SQL-standard ON CONFLICT clause.
+func (s *mysqlStore) SaveAvatar(png []byte) (string, error) {
+	sum := md5.Sum(png)
+	hash := hex.EncodeToString(sum[:])
+
+	if _, err := s.db.Exec("INSERT IGNORE INTO avatars (hash, data) VALUES (?, ?)", hash, png); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// newStore builds the Store selected by -db-driver, using -db-dsn to connect.
+func newStore(driver, dsn string) (Store, error) {
+	switch driver {
+	case "sqlite3":
+		return newSQLiteStore(dsn)
+	case "postgres":
+		return newPostgresStore(dsn)
+	case "mysql":
+		return newMySQLStore(dsn)
+	default:
+		return nil, fmt.Errorf("unknown -db-driver %q, want sqlite3, postgres or mysql", driver)
+	}
+}